@@ -0,0 +1,133 @@
+// Command sqlite-history configures SQLite history triggers for one or more
+// tables in a database file.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/r-malon/sqlite-history/pkg/sqlitehistory"
+)
+
+func main() {
+	batchSize := flag.Int("batch-size", 0, "rows per backfill batch (default 1000)")
+	verbose := flag.Bool("verbose", false, "log debug-level progress, including per-batch backfill progress")
+	dryRun := flag.Bool("dry-run", false, "print the DDL/DML that would be executed, without touching the database")
+	all := flag.Bool("all", false, "configure history for every table in the database")
+	flag.BoolVar(all, "A", false, "shorthand for --all")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <database_path> [tables... | -A | --all]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	dbPath := args[0]
+	tables := args[1:]
+
+	level := slog.LevelInfo
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		logger.Error("database file does not exist", "path", dbPath)
+		os.Exit(1)
+	}
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		logger.Error("failed to open database", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	sh := sqlitehistory.New(db)
+	sh.Logger = logger
+
+	ctx := context.Background()
+
+	if *all {
+		tables, err = sh.GetAllRegularTables(ctx)
+		if err != nil {
+			logger.Error("failed to get table list", "error", err)
+			os.Exit(1)
+		}
+	} else if len(tables) == 0 {
+		logger.Error("no tables provided; pass table names or use --all")
+		os.Exit(1)
+	} else {
+		allTables, err := sh.GetAllRegularTables(ctx)
+		if err != nil {
+			logger.Error("failed to get table list for validation", "error", err)
+			os.Exit(1)
+		}
+		tableSet := make(map[string]bool, len(allTables))
+		for _, table := range allTables {
+			tableSet[table] = true
+		}
+		var missing []string
+		for _, table := range tables {
+			if !tableSet[table] {
+				missing = append(missing, table)
+			}
+		}
+		if len(missing) > 0 {
+			logger.Error("tables do not exist", "tables", strings.Join(missing, ", "))
+			os.Exit(1)
+		}
+	}
+
+	opts := sqlitehistory.ConfigureOptions{BatchSize: *batchSize}
+	if err := configureTriggers(ctx, sh, tables, opts, *dryRun); err != nil {
+		logger.Error("failed to configure triggers", "error", err)
+		os.Exit(1)
+	}
+}
+
+// configureTriggers configures history tracking for each of tables, skipping
+// history tables themselves and tables already configured. dryRun prints the
+// SQL ConfigureHistory would run for each remaining table instead of running
+// it.
+func configureTriggers(ctx context.Context, sh *sqlitehistory.SQLiteHistory, tables []string, opts sqlitehistory.ConfigureOptions, dryRun bool) error {
+	for _, table := range tables {
+		if sqlitehistory.IsInternalHistoryTable(table) {
+			continue
+		}
+
+		historyTableName := fmt.Sprintf("_%s_history", table)
+		exists, err := sh.TableExists(ctx, historyTableName)
+		if err != nil {
+			return fmt.Errorf("failed to check if history table exists: %w", err)
+		}
+		if exists {
+			sh.Logger.InfoContext(ctx, "history table already exists, skipping", "table", table)
+			continue
+		}
+
+		if dryRun {
+			preview, err := sh.PreviewConfigureHistory(ctx, table, opts)
+			if err != nil {
+				return fmt.Errorf("failed to preview history for table %s: %w", table, err)
+			}
+			fmt.Printf("-- %s\n%s\n%s\n-- backfill (batched, one example batch shown)\n%s\n", table, preview.HistoryTableSQL, preview.TriggersSQL, preview.BackfillQuery)
+			continue
+		}
+
+		if err := sh.ConfigureHistory(ctx, table, opts); err != nil {
+			return fmt.Errorf("failed to configure history for table %s: %w", table, err)
+		}
+		sh.Logger.InfoContext(ctx, "configured history", "table", table)
+	}
+	return nil
+}
@@ -0,0 +1,1657 @@
+// Package sqlitehistory configures SQLite triggers that record an audit
+// history of changes to a table, and provides time-travel queries, reverts,
+// and retention-based pruning over that history.
+package sqlitehistory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// defaultBatchSize is used by ConfigureHistory's backfill when
+// ConfigureOptions.BatchSize is zero.
+const defaultBatchSize = 1000
+
+// ColumnInfo represents a column's name and type
+type ColumnInfo struct {
+	Name string
+	Type string
+}
+
+// SQLiteHistory provides methods for configuring history tracking
+type SQLiteHistory struct {
+	db *sql.DB
+
+	// Logger receives progress output (e.g. backfill batch progress,
+	// tables configured) that earlier versions of this package wrote with
+	// fmt.Printf. It defaults to slog.Default() and may be overwritten
+	// directly; callers that want silence can set it to
+	// slog.New(slog.NewTextHandler(io.Discard, nil)).
+	Logger *slog.Logger
+}
+
+// New creates a new SQLiteHistory instance
+func New(db *sql.DB) *SQLiteHistory {
+	return &SQLiteHistory{db: db, Logger: slog.Default()}
+}
+
+// ConfigureOptions controls optional features enabled when configuring
+// history tracking for a table.
+type ConfigureOptions struct {
+	// Actor, Reason, and TxnID add the corresponding attribution column
+	// (_actor, _reason, _txn_id) to the history table. The columns are
+	// populated from the session state set up by WithContext; writes made
+	// outside of a WithContext transaction record null, since WithContext
+	// clears that state again once its transaction commits or rolls back.
+	Actor  bool
+	Reason bool
+	TxnID  bool
+
+	// BatchSize controls how many rows ConfigureHistory backfills per
+	// INSERT ... SELECT ... LIMIT batch, so configuring history on a table
+	// with millions of rows doesn't hold an unbounded single transaction
+	// open. Zero uses defaultBatchSize.
+	BatchSize int
+}
+
+// HistoryContext carries attribution values recorded by WithContext into the
+// _actor, _reason, and _txn_id columns of history tables configured with the
+// matching ConfigureOptions.
+type HistoryContext struct {
+	Actor  string
+	Reason string
+	TxnID  string
+}
+
+// ensureContextTable creates the _sqlite_history_context table if it does
+// not already exist. Attribution triggers reference this table unconditionally
+// whenever any attribution column is enabled, so it must exist before the
+// first ordinary write to an attribution-tracked table, not just by the time
+// WithContext is first called.
+func ensureContextTable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS _sqlite_history_context (
+    actor TEXT,
+    reason TEXT,
+    txn_id TEXT
+);
+`)
+	return err
+}
+
+// HistoryTx wraps the transaction opened by WithContext so that Commit and
+// Rollback always clear the _sqlite_history_context row afterward, however
+// the caller's transaction ends. Without this, the row set up by WithContext
+// would otherwise survive until the next WithContext call, and an ordinary
+// write made in between would be attributed to the previous, stale context
+// instead of recording null.
+type HistoryTx struct {
+	*sql.Tx
+	sh *SQLiteHistory
+}
+
+// clearContext resets the context row to null. It runs after the wrapped
+// transaction has already ended, so it uses sh.db rather than the finished tx.
+func (sh *SQLiteHistory) clearContext(ctx context.Context) error {
+	_, err := sh.db.ExecContext(ctx, `UPDATE _sqlite_history_context SET actor = NULL, reason = NULL, txn_id = NULL;`)
+	return err
+}
+
+// Commit commits the wrapped transaction, then clears the context row. The
+// context row is cleared on a best-effort basis: if the commit itself failed,
+// that error takes precedence.
+func (htx *HistoryTx) Commit(ctx context.Context) error {
+	err := htx.Tx.Commit()
+	if clearErr := htx.sh.clearContext(ctx); err == nil && clearErr != nil {
+		return fmt.Errorf("failed to clear context after commit: %w", clearErr)
+	}
+	return err
+}
+
+// Rollback rolls back the wrapped transaction, then clears the context row.
+func (htx *HistoryTx) Rollback(ctx context.Context) error {
+	err := htx.Tx.Rollback()
+	if clearErr := htx.sh.clearContext(ctx); err == nil && clearErr != nil {
+		return fmt.Errorf("failed to clear context after rollback: %w", clearErr)
+	}
+	return err
+}
+
+// WithContext opens a transaction and records ctx in the
+// _sqlite_history_context table, so the insert/update/delete triggers of any
+// table configured with attribution columns can read it back. Triggers can't
+// reference temp-database objects, so this is an ordinary table in the main
+// database holding a single row; what keeps concurrent WithContext callers
+// from clobbering each other's context is SQLite's single-writer lock, which
+// WithContext's first write acquires and holds until the caller commits or
+// rolls back. The returned *HistoryTx clears that row again once the caller
+// calls Commit or Rollback, so callers should always go through WithContext
+// rather than sh.db.BeginTx(ctx, nil) directly when writing to attribution-tracked
+// tables.
+func (sh *SQLiteHistory) WithContext(ctx context.Context, hctx HistoryContext) (*HistoryTx, error) {
+	tx, err := sh.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := ensureContextTable(ctx, tx); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create context table: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM _sqlite_history_context;`); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to reset context table: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, 
+		`INSERT INTO _sqlite_history_context (actor, reason, txn_id) VALUES (?, ?, ?);`,
+		hctx.Actor, hctx.Reason, hctx.TxnID,
+	); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to set context: %w", err)
+	}
+
+	return &HistoryTx{Tx: tx, sh: sh}, nil
+}
+
+// ConfigureHistory sets up history tracking for a table
+func (sh *SQLiteHistory) ConfigureHistory(ctx context.Context, table string, opts ConfigureOptions) error {
+	// Get table schema
+	columns, err := sh.getTableColumnsAndTypes(ctx, sh.db, table)
+	if err != nil {
+		return fmt.Errorf("failed to get table schema: %w", err)
+	}
+
+	columnNames := make([]string, len(columns))
+	for i, col := range columns {
+		columnNames[i] = col.Name
+	}
+
+	// Begin transaction
+	tx, err := sh.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := sh.ensureMetaTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create meta table: %w", err)
+	}
+
+	if opts.Actor || opts.Reason || opts.TxnID {
+		if err := ensureContextTable(ctx, tx); err != nil {
+			return fmt.Errorf("failed to create context table: %w", err)
+		}
+	}
+
+	// This is the table's first configuration, so it has no persisted bit
+	// order yet: columnBits assigns sequential bits matching columnNames.
+	bits, err := sh.columnBits(ctx, tx, table, columnNames)
+	if err != nil {
+		return fmt.Errorf("failed to assign mask bits: %w", err)
+	}
+
+	// Create history table
+	historyTableSQL := sh.generateHistoryTableSQL(table, columns, opts)
+	if _, err := tx.ExecContext(ctx, historyTableSQL); err != nil {
+		return fmt.Errorf("failed to create history table: %w", err)
+	}
+
+	// Create triggers
+	triggersSQL := sh.generateTriggersSQL(table, columnNames, bits, opts)
+	if _, err := tx.ExecContext(ctx, triggersSQL); err != nil {
+		return fmt.Errorf("failed to create triggers: %w", err)
+	}
+
+	// Backfill history table. This still runs inside tx, so a table with
+	// millions of rows keeps that transaction open for the whole backfill;
+	// batching bounds each statement's size rather than the transaction's
+	// lifetime (see backfillHistory).
+	if err := sh.backfillHistory(ctx, tx, table, columnNames, bits, opts.BatchSize); err != nil {
+		return fmt.Errorf("failed to backfill history: %w", err)
+	}
+
+	if err := recordMeta(ctx, tx, table, columnNames, opts); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ConfigurePreview holds the DDL/DML ConfigureHistory would execute for a
+// table, as returned by PreviewConfigureHistory.
+type ConfigurePreview struct {
+	HistoryTableSQL string
+	TriggersSQL     string
+	BackfillQuery   string
+}
+
+// PreviewConfigureHistory works out the mask bits and SQL ConfigureHistory
+// would use for table under opts, without creating or writing anything, for
+// --dry-run callers that want to show what ConfigureHistory would do.
+func (sh *SQLiteHistory) PreviewConfigureHistory(ctx context.Context, table string, opts ConfigureOptions) (ConfigurePreview, error) {
+	columns, err := sh.getTableColumnsAndTypes(ctx, sh.db, table)
+	if err != nil {
+		return ConfigurePreview{}, fmt.Errorf("failed to get table schema: %w", err)
+	}
+
+	columnNames := make([]string, len(columns))
+	for i, col := range columns {
+		columnNames[i] = col.Name
+	}
+
+	bits, err := sh.columnBits(ctx, sh.db, table, columnNames)
+	if err != nil {
+		return ConfigurePreview{}, fmt.Errorf("failed to assign mask bits: %w", err)
+	}
+
+	backfillQuery, _ := backfillHistorySQL(table, columnNames, bits)
+	return ConfigurePreview{
+		HistoryTableSQL: sh.generateHistoryTableSQL(table, columns, opts),
+		TriggersSQL:     sh.generateTriggersSQL(table, columnNames, bits, opts),
+		BackfillQuery:   backfillQuery,
+	}, nil
+}
+
+// getTableColumnsAndTypes retrieves column information for a table. q is
+// usually sh.db, but callers that already hold an open transaction (e.g.
+// Prune) pass it instead, so this reads through the same connection rather
+// than requesting a second one from the pool while the transaction's
+// connection is still checked out.
+func (sh *SQLiteHistory) getTableColumnsAndTypes(ctx context.Context, q dbLike, table string) ([]ColumnInfo, error) {
+	query := fmt.Sprintf("PRAGMA table_info([%s]);", table)
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []ColumnInfo
+	for rows.Next() {
+		var cid int
+		var name, dataType string
+		var notNull, pk int
+		var defaultValue interface{}
+
+		if err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		columns = append(columns, ColumnInfo{Name: name, Type: dataType})
+	}
+
+	return columns, rows.Err()
+}
+
+// attributionColumns returns the optional attribution column names enabled
+// in opts, in schema order.
+func attributionColumns(opts ConfigureOptions) []string {
+	var cols []string
+	if opts.Actor {
+		cols = append(cols, "_actor")
+	}
+	if opts.Reason {
+		cols = append(cols, "_reason")
+	}
+	if opts.TxnID {
+		cols = append(cols, "_txn_id")
+	}
+	return cols
+}
+
+// attributionValueExprs returns the SQL expressions that populate the
+// attribution columns from the _sqlite_history_context table, in the same
+// order as attributionColumns. SQLite triggers can't reference temp-database
+// objects, so the context table lives in the main database; WithContext
+// relies on SQLite's single-writer transaction lock, not connection
+// scoping, to keep concurrent callers from clobbering each other's context.
+func attributionValueExprs(opts ConfigureOptions) []string {
+	var exprs []string
+	if opts.Actor {
+		exprs = append(exprs, "(SELECT actor FROM _sqlite_history_context LIMIT 1)")
+	}
+	if opts.Reason {
+		exprs = append(exprs, "(SELECT reason FROM _sqlite_history_context LIMIT 1)")
+	}
+	if opts.TxnID {
+		exprs = append(exprs, "(SELECT txn_id FROM _sqlite_history_context LIMIT 1)")
+	}
+	return exprs
+}
+
+// generateHistoryTableSQL creates SQL for the history table
+func (sh *SQLiteHistory) generateHistoryTableSQL(table string, columns []ColumnInfo, opts ConfigureOptions) string {
+	var columnDefs []string
+	for _, col := range columns {
+		columnDefs = append(columnDefs, fmt.Sprintf("    %s %s", escapeSQLite(col.Name), col.Type))
+	}
+
+	var extraDefs string
+	for _, col := range attributionColumns(opts) {
+		extraDefs += fmt.Sprintf(",\n    %s TEXT", col)
+	}
+
+	return fmt.Sprintf(`
+CREATE TABLE _%s_history (
+    _rowid INTEGER,
+%s,
+    _version INTEGER,
+    _updated INTEGER,
+    _mask INTEGER%s
+);
+CREATE INDEX idx_%s_history_rowid ON _%s_history (_rowid);
+`, table, strings.Join(columnDefs, ",\n"), extraDefs, table, table)
+}
+
+// generateTriggersSQL creates SQL for insert, update, and delete triggers.
+// bits gives the mask bit assigned to each entry of columns (see
+// columnBits), so mask values stay stable across schema migrations instead
+// of always spanning the low len(columns) bits.
+func (sh *SQLiteHistory) generateTriggersSQL(table string, columns []string, bits []int, opts ConfigureOptions) string {
+	escapedColumns := make([]string, len(columns))
+	newColumnValues := make([]string, len(columns))
+	oldColumnValues := make([]string, len(columns))
+
+	for i, col := range columns {
+		escaped := escapeSQLite(col)
+		escapedColumns[i] = escaped
+		newColumnValues[i] = "new." + escaped
+		oldColumnValues[i] = "old." + escaped
+	}
+
+	attrCols := attributionColumns(opts)
+	attrExprs := attributionValueExprs(opts)
+	attrColsSQL, attrValuesSQL := "", ""
+	if len(attrCols) > 0 {
+		attrColsSQL = ", " + strings.Join(attrCols, ", ")
+		attrValuesSQL = ", " + strings.Join(attrExprs, ", ")
+	}
+
+	columnNames := strings.Join(escapedColumns, ", ") + attrColsSQL
+	newValues := strings.Join(newColumnValues, ", ") + attrValuesSQL
+	oldValues := strings.Join(oldColumnValues, ", ") + attrValuesSQL
+	mask := fullActiveMask(bits)
+
+	// Insert trigger. The version is computed the same way as the delete
+	// trigger's, rather than hardcoded to 1, so that re-inserting a rowid
+	// that already has history (e.g. Revert/RevertAt restoring a deleted
+	// row) continues the same version sequence instead of colliding with it.
+	insertTrigger := fmt.Sprintf(`
+CREATE TRIGGER %s_insert_history
+AFTER INSERT ON %s
+BEGIN
+    INSERT INTO _%s_history (_rowid, %s, _version, _updated, _mask)
+    VALUES (
+        new.rowid,
+        %s,
+        (SELECT COALESCE(MAX(_version), 0) FROM _%s_history WHERE _rowid = new.rowid) + 1,
+        cast((julianday('now') - 2440587.5) * 86400 * 1000 as integer),
+        %d
+    );
+END;
+`, table, table, table, columnNames, newValues, table, mask)
+
+	// Update trigger
+	var updateColumns []string
+	for _, col := range columns {
+		escaped := escapeSQLite(col)
+		updateColumns = append(updateColumns, fmt.Sprintf(`
+        CASE WHEN old.%s IS NOT new.%s then new.%s else null end`, escaped, escaped, escaped))
+	}
+	updateColumnsSQL := strings.Join(updateColumns, ",") + attrValuesSQL
+
+	var maskParts []string
+	for i, col := range columns {
+		escaped := escapeSQLite(col)
+		base := int64(1) << uint(bits[i])
+		maskParts = append(maskParts, fmt.Sprintf("(CASE WHEN old.%s IS NOT new.%s then %d else 0 end)", escaped, escaped, base))
+	}
+	maskSQL := strings.Join(maskParts, " + ")
+
+	var whereParts []string
+	for _, col := range columns {
+		escaped := escapeSQLite(col)
+		whereParts = append(whereParts, fmt.Sprintf("old.%s IS NOT new.%s", escaped, escaped))
+	}
+	whereSQL := strings.Join(whereParts, " or ")
+
+	updateTrigger := fmt.Sprintf(`
+CREATE TRIGGER %s_update_history
+AFTER UPDATE ON %s
+FOR EACH ROW
+BEGIN
+    INSERT INTO _%s_history (_rowid, %s, _version, _updated, _mask)
+    SELECT old.rowid, %s,
+        (SELECT MAX(_version) FROM _%s_history WHERE _rowid = old.rowid) + 1,
+        cast((julianday('now') - 2440587.5) * 86400 * 1000 as integer),
+        %s
+    WHERE %s;
+END;
+`, table, table, table, columnNames, updateColumnsSQL, table, maskSQL, whereSQL)
+
+	// Delete trigger
+	deleteTrigger := fmt.Sprintf(`
+CREATE TRIGGER %s_delete_history
+AFTER DELETE ON %s
+BEGIN
+    INSERT INTO _%s_history (_rowid, %s, _version, _updated, _mask)
+    VALUES (
+        old.rowid,
+        %s,
+        (SELECT COALESCE(MAX(_version), 0) from _%s_history WHERE _rowid = old.rowid) + 1,
+        cast((julianday('now') - 2440587.5) * 86400 * 1000 as integer),
+        -1
+    );
+END;
+`, table, table, table, columnNames, oldValues, table)
+
+	return insertTrigger + updateTrigger + deleteTrigger
+}
+
+// backfillHistorySQL returns the INSERT ... SELECT ... LIMIT template used by
+// backfillHistory for a single batch, and the WHERE rowid > ? LIMIT ?
+// arguments are left for the caller to bind. bits gives the mask bit
+// assigned to each entry of columns (see columnBits).
+func backfillHistorySQL(table string, columns []string, bits []int) (query string, mask int64) {
+	escapedColumns := make([]string, len(columns))
+	for i, col := range columns {
+		escapedColumns[i] = escapeSQLite(col)
+	}
+	columnNames := strings.Join(escapedColumns, ", ")
+	mask = fullActiveMask(bits)
+
+	query = fmt.Sprintf(`
+INSERT INTO _%s_history (_rowid, %s, _version, _updated, _mask)
+SELECT rowid, %s, 1, cast((julianday('now') - 2440587.5) * 86400 * 1000 as integer), ?
+FROM %s WHERE rowid > ? ORDER BY rowid LIMIT ?;
+`, table, columnNames, columnNames, table)
+	return query, mask
+}
+
+// backfillHistory populates history for table's existing rows in batches of
+// batchSize (defaultBatchSize if zero), rather than a single INSERT ...
+// SELECT spanning the whole table. ConfigureHistory still runs the whole
+// backfill inside one transaction, so this doesn't bound how long that
+// transaction stays open on a table with millions of rows - it bounds the
+// size of each individual statement, gives ctx a cancellation point between
+// batches, and lets progress be logged incrementally instead of as a single
+// opaque INSERT. bits gives the mask bit assigned to each entry of columns
+// (see columnBits).
+func (sh *SQLiteHistory) backfillHistory(ctx context.Context, tx *sql.Tx, table string, columns []string, bits []int, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	query, mask := backfillHistorySQL(table, columns, bits)
+	maxRowidQuery := fmt.Sprintf(
+		"SELECT MAX(rowid) FROM (SELECT rowid FROM %s WHERE rowid > ? ORDER BY rowid LIMIT ?);",
+		escapeSQLite(table),
+	)
+
+	var lastRowid int64
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, query, mask, lastRowid, batchSize)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		if err := tx.QueryRowContext(ctx, maxRowidQuery, lastRowid, batchSize).Scan(&lastRowid); err != nil {
+			return err
+		}
+		total += n
+		sh.Logger.DebugContext(ctx, "backfilled history batch", "table", table, "rows", n, "through_rowid", lastRowid)
+	}
+	sh.Logger.InfoContext(ctx, "backfilled history", "table", table, "rows", total)
+	return nil
+}
+
+// systemHistoryColumns are the bookkeeping columns present on every history
+// table that don't correspond to a column on the live table, and so must
+// never be touched by schema migration.
+var systemHistoryColumns = map[string]bool{
+	"_rowid":   true,
+	"_version": true,
+	"_updated": true,
+	"_mask":    true,
+	"_actor":   true,
+	"_reason":  true,
+	"_txn_id":  true,
+}
+
+// IsInternalHistoryTable reports whether name is a table the library itself
+// manages: a per-table history table, or a shared bookkeeping table such as
+// _sqlite_history_meta or _sqlite_history_context. These are never tracked
+// as regular user tables.
+func IsInternalHistoryTable(name string) bool {
+	if strings.HasPrefix(name, "_") && strings.HasSuffix(name, "_history") {
+		return true
+	}
+	return strings.HasPrefix(name, "_sqlite_history_")
+}
+
+// ensureMetaTable creates the _sqlite_history_meta table used to track
+// schema migration state, if it doesn't already exist.
+func (sh *SQLiteHistory) ensureMetaTable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS _sqlite_history_meta (
+    table_name TEXT PRIMARY KEY,
+    schema_version INTEGER NOT NULL,
+    columns TEXT NOT NULL,
+    actor INTEGER NOT NULL DEFAULT 0,
+    reason INTEGER NOT NULL DEFAULT 0,
+    txn_id INTEGER NOT NULL DEFAULT 0,
+    max_age_ms INTEGER NOT NULL DEFAULT 0,
+    max_versions_per_row INTEGER NOT NULL DEFAULT 0,
+    keep_checkpoint_every_ms INTEGER NOT NULL DEFAULT 0
+);
+`)
+	return err
+}
+
+// boolToInt converts a bool to the 0/1 SQLite stores ConfigureOptions flags
+// as in _sqlite_history_meta.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// recordMeta upserts the schema-version row for table, bumping the version
+// on conflict. order is the table's full mask bit order (see
+// readMetaColumnOrder) - not just the currently active columns, since
+// dropped columns must stay in it to keep their bit reserved. It must run
+// inside the same transaction as the schema change it's recording.
+func recordMeta(ctx context.Context, tx *sql.Tx, table string, order []string, opts ConfigureOptions) error {
+	_, err := tx.ExecContext(ctx, `
+INSERT INTO _sqlite_history_meta (table_name, schema_version, columns, actor, reason, txn_id)
+VALUES (?, 1, ?, ?, ?, ?)
+ON CONFLICT(table_name) DO UPDATE SET
+    schema_version = schema_version + 1,
+    columns = excluded.columns,
+    actor = excluded.actor,
+    reason = excluded.reason,
+    txn_id = excluded.txn_id;
+`, table, strings.Join(order, ","), boolToInt(opts.Actor), boolToInt(opts.Reason), boolToInt(opts.TxnID))
+	return err
+}
+
+// readMetaOptions returns the ConfigureOptions previously recorded for table
+// in _sqlite_history_meta, or the zero value if no row exists yet.
+func readMetaOptions(ctx context.Context, tx *sql.Tx, table string) (ConfigureOptions, error) {
+	var actor, reason, txnID int
+	err := tx.QueryRowContext(ctx, 
+		`SELECT actor, reason, txn_id FROM _sqlite_history_meta WHERE table_name = ?;`, table,
+	).Scan(&actor, &reason, &txnID)
+	if err == sql.ErrNoRows {
+		return ConfigureOptions{}, nil
+	} else if err != nil {
+		return ConfigureOptions{}, err
+	}
+	return ConfigureOptions{Actor: actor != 0, Reason: reason != 0, TxnID: txnID != 0}, nil
+}
+
+// dbLike is satisfied by both *sql.DB and *sql.Tx, letting the helpers below
+// run either against the pool or inside a caller's existing transaction.
+type dbLike interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// readMetaColumnOrder returns table's persisted, append-only mask bit order:
+// position i in the returned slice is the column assigned bit 1<<i. It's nil
+// if table has no _sqlite_history_meta row yet (never configured).
+//
+// The order only ever grows: MigrateHistory appends newly-added columns to
+// the end and relabels renamed ones in place, but never removes or reuses
+// the bit of a column that's since been dropped, so a _mask value recorded
+// under any past schema version keeps decoding against the same column.
+func readMetaColumnOrder(ctx context.Context, q dbLike, table string) ([]string, error) {
+	var columns string
+	err := q.QueryRowContext(ctx, `SELECT columns FROM _sqlite_history_meta WHERE table_name = ?;`, table).Scan(&columns)
+	if err == sql.ErrNoRows || columns == "" {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return strings.Split(columns, ","), nil
+}
+
+// columnBitOrder computes the append-only bit order for table's next
+// migration from its previously stored order (nil if this is the first
+// time): a rename relabels an existing entry in place, keeping its bit, and
+// any live column not already present is appended at the end, claiming the
+// next free bit. Entries for columns that are no longer live (dropped) are
+// carried over unchanged so their bit is never reused.
+func columnBitOrder(stored []string, renames map[string]string, liveNames []string) []string {
+	order := append([]string(nil), stored...)
+	indexOf := make(map[string]int, len(order))
+	for i, name := range order {
+		indexOf[name] = i
+	}
+
+	for oldName, newName := range renames {
+		i, hasOld := indexOf[oldName]
+		_, hasNew := indexOf[newName]
+		if hasOld && !hasNew {
+			order[i] = newName
+			indexOf[newName] = i
+			delete(indexOf, oldName)
+		}
+	}
+
+	for _, name := range liveNames {
+		if _, ok := indexOf[name]; !ok {
+			indexOf[name] = len(order)
+			order = append(order, name)
+		}
+	}
+
+	return order
+}
+
+// columnBits returns the mask bit assigned to each of liveNames, in order,
+// consulting table's persisted bit order (see readMetaColumnOrder) so the
+// bits stay stable across migrations. Tables with no persisted order yet
+// (never configured) get sequential bits matching the order ConfigureHistory
+// will record.
+func (sh *SQLiteHistory) columnBits(ctx context.Context, q dbLike, table string, liveNames []string) ([]int, error) {
+	stored, err := readMetaColumnOrder(ctx, q, table)
+	if err != nil {
+		return nil, err
+	}
+	indexOf := make(map[string]int, len(stored))
+	for i, name := range stored {
+		indexOf[name] = i
+	}
+
+	bits := make([]int, len(liveNames))
+	next := len(stored)
+	for i, name := range liveNames {
+		if bit, ok := indexOf[name]; ok {
+			bits[i] = bit
+		} else {
+			bits[i] = next
+			next++
+		}
+	}
+	return bits, nil
+}
+
+// fullActiveMask ORs together the mask bit for every currently active
+// column. It's the _mask value that marks a history entry - an insert, a
+// backfill row, or a Prune checkpoint - as holding every active column's
+// current value.
+func fullActiveMask(bits []int) int64 {
+	var mask int64
+	for _, bit := range bits {
+		mask |= int64(1) << uint(bit)
+	}
+	return mask
+}
+
+// MigrateHistory brings the history table and triggers for table up to date
+// with the table's current live schema. It is safe to call repeatedly:
+// columns that already exist are left untouched and the triggers are always
+// recreated from the current column set, so re-running this after every DDL
+// change on the live table is the expected usage.
+//
+// New columns are added to the history table as nullable, so existing rows
+// remain valid. Columns dropped from the live table are left in the history
+// table, with their past values intact, and are simply excluded from the
+// regenerated triggers. renames maps old column names to new column names
+// for columns that were renamed (rather than dropped and re-added) since the
+// history table was last migrated; pass nil if there were none.
+//
+// opts adds any attribution columns (_actor, _reason, _txn_id) not already
+// present; attribution columns enabled by a previous ConfigureHistory or
+// MigrateHistory call for this table stay enabled even if opts doesn't ask
+// for them again.
+func (sh *SQLiteHistory) MigrateHistory(ctx context.Context, table string, renames map[string]string, opts ConfigureOptions) error {
+	liveColumns, err := sh.getTableColumnsAndTypes(ctx, sh.db, table)
+	if err != nil {
+		return fmt.Errorf("failed to get table schema: %w", err)
+	}
+
+	historyTable := fmt.Sprintf("_%s_history", table)
+	historyColumns, err := sh.getTableColumnsAndTypes(ctx, sh.db, historyTable)
+	if err != nil {
+		return fmt.Errorf("failed to get history table schema: %w", err)
+	}
+
+	tx, err := sh.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := sh.ensureMetaTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create meta table: %w", err)
+	}
+
+	storedOpts, err := readMetaOptions(ctx, tx, table)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	opts.Actor = opts.Actor || storedOpts.Actor
+	opts.Reason = opts.Reason || storedOpts.Reason
+	opts.TxnID = opts.TxnID || storedOpts.TxnID
+
+	if opts.Actor || opts.Reason || opts.TxnID {
+		if err := ensureContextTable(ctx, tx); err != nil {
+			return fmt.Errorf("failed to create context table: %w", err)
+		}
+	}
+
+	rawHistoryColumns := make(map[string]bool, len(historyColumns))
+	historyColumnNames := make(map[string]bool, len(historyColumns))
+	for _, col := range historyColumns {
+		rawHistoryColumns[col.Name] = true
+		if !systemHistoryColumns[col.Name] {
+			historyColumnNames[col.Name] = true
+		}
+	}
+
+	for _, col := range attributionColumns(opts) {
+		if rawHistoryColumns[col] {
+			continue
+		}
+		addSQL := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s TEXT;", escapeSQLite(historyTable), col)
+		if _, err := tx.ExecContext(ctx, addSQL); err != nil {
+			return fmt.Errorf("failed to add attribution column %s: %w", col, err)
+		}
+		rawHistoryColumns[col] = true
+	}
+
+	for oldName, newName := range renames {
+		if !historyColumnNames[oldName] || historyColumnNames[newName] {
+			continue
+		}
+		renameSQL := fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;",
+			escapeSQLite(historyTable), escapeSQLite(oldName), escapeSQLite(newName))
+		if _, err := tx.ExecContext(ctx, renameSQL); err != nil {
+			return fmt.Errorf("failed to rename history column %s: %w", oldName, err)
+		}
+		delete(historyColumnNames, oldName)
+		historyColumnNames[newName] = true
+	}
+
+	// order is the table's mask bit order going forward: renamed columns are
+	// relabeled in place (keeping their bit) and any column not seen before
+	// is appended, claiming the next free bit. Bits already assigned to a
+	// column that's since been dropped are never reused, so _mask values
+	// recorded under an older schema version keep decoding correctly even
+	// after this migration.
+	storedOrder, err := readMetaColumnOrder(ctx, tx, table)
+	if err != nil {
+		return fmt.Errorf("failed to read column bit order: %w", err)
+	}
+	liveNames := make([]string, len(liveColumns))
+	for i, col := range liveColumns {
+		liveNames[i] = col.Name
+	}
+	order := columnBitOrder(storedOrder, renames, liveNames)
+	bitOf := make(map[string]int, len(order))
+	for i, name := range order {
+		bitOf[name] = i
+	}
+
+	// activeColumns and activeBits drive the regenerated triggers: every
+	// live column the history table now has (adding it first if this is the
+	// first time we've seen it), paired with its persisted mask bit.
+	var activeColumns []string
+	var activeBits []int
+	for _, col := range liveColumns {
+		if !historyColumnNames[col.Name] {
+			addSQL := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;",
+				escapeSQLite(historyTable), escapeSQLite(col.Name), col.Type)
+			if _, err := tx.ExecContext(ctx, addSQL); err != nil {
+				return fmt.Errorf("failed to add history column %s: %w", col.Name, err)
+			}
+			historyColumnNames[col.Name] = true
+		}
+		activeColumns = append(activeColumns, col.Name)
+		activeBits = append(activeBits, bitOf[col.Name])
+	}
+
+	for _, suffix := range []string{"insert", "update", "delete"} {
+		dropSQL := fmt.Sprintf("DROP TRIGGER IF EXISTS %s_%s_history;", table, suffix)
+		if _, err := tx.ExecContext(ctx, dropSQL); err != nil {
+			return fmt.Errorf("failed to drop %s trigger: %w", suffix, err)
+		}
+	}
+
+	triggersSQL := sh.generateTriggersSQL(table, activeColumns, activeBits, opts)
+	if _, err := tx.ExecContext(ctx, triggersSQL); err != nil {
+		return fmt.Errorf("failed to recreate triggers: %w", err)
+	}
+
+	if err := recordMeta(ctx, tx, table, order, opts); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// MigrateAll runs MigrateHistory, with no column renames and no newly
+// requested attribution columns, against every table that already has
+// history tracking configured. Use MigrateHistory directly for tables whose
+// migration needs a rename mapping or enables an attribution column for the
+// first time.
+func (sh *SQLiteHistory) MigrateAll(ctx context.Context) error {
+	tables, err := sh.GetAllRegularTables(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get table list: %w", err)
+	}
+
+	for _, table := range tables {
+		if IsInternalHistoryTable(table) {
+			continue
+		}
+
+		exists, err := sh.TableExists(ctx, fmt.Sprintf("_%s_history", table))
+		if err != nil {
+			return fmt.Errorf("failed to check if history table exists: %w", err)
+		}
+		if !exists {
+			continue
+		}
+
+		if err := sh.MigrateHistory(ctx, table, nil, ConfigureOptions{}); err != nil {
+			return fmt.Errorf("failed to migrate history for table %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// VersionInfo describes a single history entry for a row, as returned by
+// Versions.
+type VersionInfo struct {
+	Version int64
+	Updated time.Time
+	// Deleted is true if this entry is the delete tombstone (_mask = -1).
+	Deleted bool
+	// Changed lists the columns that were written by this entry. It is nil
+	// for the delete tombstone.
+	Changed []string
+}
+
+// decodeMask translates a _mask bitmap into the list of column names it
+// marks as changed, given the column order the mask was generated against.
+// A mask of -1 (the delete tombstone) decodes to nil.
+func decodeMask(columns []string, mask int64) []string {
+	if mask < 0 {
+		return nil
+	}
+	var changed []string
+	for i, col := range columns {
+		if mask&(1<<uint(i)) != 0 {
+			changed = append(changed, col)
+		}
+	}
+	return changed
+}
+
+// Versions returns the history entries recorded for a row, oldest first.
+func (sh *SQLiteHistory) Versions(ctx context.Context, table string, rowid int64) ([]VersionInfo, error) {
+	// Decode against the table's full persisted bit order, not just its
+	// current live columns, so entries from before a column was dropped
+	// still report the right name in Changed instead of whatever column
+	// happens to occupy that bit now.
+	names, err := readMetaColumnOrder(ctx, sh.db, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read column bit order: %w", err)
+	}
+	if names == nil {
+		columns, err := sh.getTableColumnsAndTypes(ctx, sh.db, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get table schema: %w", err)
+		}
+		names = columnNames(columns)
+	}
+
+	query := fmt.Sprintf(
+		"SELECT _version, _updated, _mask FROM _%s_history WHERE _rowid = ? ORDER BY _version;",
+		table,
+	)
+	rows, err := sh.db.QueryContext(ctx, query, rowid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []VersionInfo
+	for rows.Next() {
+		var version, updatedMillis, mask int64
+		if err := rows.Scan(&version, &updatedMillis, &mask); err != nil {
+			return nil, err
+		}
+		versions = append(versions, VersionInfo{
+			Version: version,
+			Updated: time.UnixMilli(updatedMillis),
+			Deleted: mask == -1,
+			Changed: decodeMask(names, mask),
+		})
+	}
+
+	return versions, rows.Err()
+}
+
+// RowAt reconstructs the state of a row as of a given instant by walking
+// _<table>_history in version order and, for each history entry, applying
+// only the columns its _mask marks as changed. A _mask of -1 is a delete
+// tombstone: if the row's most recent entry at or before at is a tombstone,
+// RowAt returns sql.ErrNoRows, matching the behavior of a QueryRow that found
+// no rows.
+func (sh *SQLiteHistory) RowAt(ctx context.Context, table string, rowid int64, at time.Time) (map[string]any, error) {
+	current, deleted, found, err := sh.reconstructRowBy(ctx, sh.db, table, rowid, "_updated", at.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	if !found || deleted {
+		return nil, sql.ErrNoRows
+	}
+
+	return current, nil
+}
+
+// reconstructRowBy reconstructs a row's state from _<table>_history by
+// walking entries for rowid, ordered by _version, whose cutoffColumn is at
+// or before cutoff, applying only the columns each entry's _mask marks as
+// changed. cutoffColumn is "_updated" for a time cutoff or "_version" for a
+// version cutoff. It reports whether any entry matched and whether the most
+// recent matching entry is the delete tombstone (_mask = -1). q is usually
+// sh.db, but Prune passes its own transaction so the reconstruction sees
+// checkpoints it has already written without blocking on its own write lock.
+func (sh *SQLiteHistory) reconstructRowBy(ctx context.Context, q dbLike, table string, rowid int64, cutoffColumn string, cutoff any) (values map[string]any, deleted bool, found bool, err error) {
+	names, err := sh.columnNamesFor(ctx, q, table)
+	if err != nil {
+		return nil, false, false, err
+	}
+	bits, err := sh.columnBits(ctx, q, table, names)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	query := fmt.Sprintf(
+		"SELECT %s, _mask FROM _%s_history WHERE _rowid = ? AND %s <= ? ORDER BY _version;",
+		strings.Join(escapeSQLiteColumns(names), ", "), table, cutoffColumn,
+	)
+	rows, err := q.QueryContext(ctx, query, rowid, cutoff)
+	if err != nil {
+		return nil, false, false, err
+	}
+	defer rows.Close()
+
+	return coalesceHistoryRows(rows, names, bits)
+}
+
+// columnNamesFor returns the live column names for table, in schema order. q
+// is usually sh.db; see getTableColumnsAndTypes.
+func (sh *SQLiteHistory) columnNamesFor(ctx context.Context, q dbLike, table string) ([]string, error) {
+	columns, err := sh.getTableColumnsAndTypes(ctx, q, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table schema: %w", err)
+	}
+	return columnNames(columns), nil
+}
+
+// coalesceHistoryRows walks history rows already filtered and ordered by
+// _version, applying only the columns each entry's _mask marks as changed.
+// bits gives the mask bit assigned to each entry of names (see columnBits).
+// It reports the coalesced column values, whether any entry matched at all,
+// and whether the most recent matching entry is the delete tombstone
+// (_mask = -1).
+func coalesceHistoryRows(rows *sql.Rows, names []string, bits []int) (values map[string]any, deleted bool, found bool, err error) {
+	rawValues := make([]any, len(names))
+	scanArgs := make([]any, len(names)+1)
+	for i := range rawValues {
+		scanArgs[i] = &rawValues[i]
+	}
+	var mask int64
+	scanArgs[len(names)] = &mask
+
+	current := make(map[string]any, len(names))
+	for rows.Next() {
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, false, false, err
+		}
+		found = true
+		deleted = mask == -1
+		if deleted {
+			continue
+		}
+		for i, name := range names {
+			if mask&(int64(1)<<uint(bits[i])) != 0 {
+				current[name] = rawValues[i]
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, false, err
+	}
+
+	return current, deleted, found, nil
+}
+
+// TableAt builds a query that reconstructs every live row of table as of a
+// given instant. For each column it correlates the most recent history entry
+// at or before the cutoff that has that column's _mask bit set, and it
+// excludes any rowid whose most recent entry at or before the cutoff is the
+// delete tombstone.
+func (sh *SQLiteHistory) TableAt(ctx context.Context, table string, at time.Time) (*sql.Rows, error) {
+	columns, err := sh.getTableColumnsAndTypes(ctx, sh.db, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table schema: %w", err)
+	}
+	bits, err := sh.columnBits(ctx, sh.db, table, columnNames(columns))
+	if err != nil {
+		return nil, fmt.Errorf("failed to assign mask bits: %w", err)
+	}
+
+	historyTable := escapeSQLite(fmt.Sprintf("_%s_history", table))
+	cutoff := at.UnixMilli()
+
+	var selects []string
+	var args []any
+	for i, col := range columns {
+		escaped := escapeSQLite(col.Name)
+		bit := int64(1) << uint(bits[i])
+		selects = append(selects, fmt.Sprintf(
+			"(SELECT %s FROM %s h2 WHERE h2._rowid = h1._rowid AND h2._updated <= ? AND (h2._mask & %d) != 0 ORDER BY h2._version DESC LIMIT 1) AS %s",
+			escaped, historyTable, bit, escaped,
+		))
+		args = append(args, cutoff)
+	}
+
+	query := fmt.Sprintf(`
+SELECT DISTINCT h1._rowid AS rowid, %s
+FROM %s h1
+WHERE h1._updated <= ?
+AND (
+    SELECT h2._mask FROM %s h2
+    WHERE h2._rowid = h1._rowid AND h2._updated <= ?
+    ORDER BY h2._version DESC LIMIT 1
+) != -1;
+`, strings.Join(selects, ",\n    "), historyTable, historyTable)
+	args = append(args, cutoff, cutoff)
+
+	return sh.db.QueryContext(ctx, query, args...)
+}
+
+// columnNames extracts the column names from a slice of ColumnInfo, in order.
+func columnNames(columns []ColumnInfo) []string {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// escapeSQLiteColumns escapes a slice of SQLite identifiers.
+func escapeSQLiteColumns(names []string) []string {
+	escaped := make([]string, len(names))
+	for i, name := range names {
+		escaped[i] = escapeSQLite(name)
+	}
+	return escaped
+}
+
+// Revert reconstructs the row's state as of toVersion (inclusive) and writes
+// it back to the live table as a new change. Because the existing update
+// trigger fires on that write, the revert is automatically recorded as a new
+// history entry, so the audit trail stays append-only and the revert itself
+// becomes a first-class historical event.
+//
+// Revert refuses to restore a row to a version whose _mask is the delete
+// tombstone unless restoreDeleted is true, in which case it INSERTs the row
+// back using its original rowid rather than UPDATE-ing it. Reverting a table
+// with UNIQUE or foreign-key constraints can fail if the reconstructed state
+// conflicts with the table's current rows; callers that need the rest of a
+// larger transaction to survive that should wrap the call in a savepoint.
+func (sh *SQLiteHistory) Revert(ctx context.Context, table string, rowid int64, toVersion int64, restoreDeleted bool) error {
+	state, deleted, found, err := sh.reconstructRowBy(ctx, sh.db, table, rowid, "_version", toVersion)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no history entry at or before version %d for %s rowid %d", toVersion, table, rowid)
+	}
+	if deleted && !restoreDeleted {
+		return fmt.Errorf("version %d of %s rowid %d is deleted; pass restoreDeleted to restore it", toVersion, table, rowid)
+	}
+
+	return sh.applyRevert(ctx, table, rowid, state)
+}
+
+// RevertAt is Revert's time-travel counterpart: it reconstructs the row's
+// state as of at and writes it back the same way. See Revert for the
+// restoreDeleted and constraint-conflict caveats.
+func (sh *SQLiteHistory) RevertAt(ctx context.Context, table string, rowid int64, at time.Time, restoreDeleted bool) error {
+	state, deleted, found, err := sh.reconstructRowBy(ctx, sh.db, table, rowid, "_updated", at.UnixMilli())
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no history entry for %s rowid %d at or before %s", table, rowid, at)
+	}
+	if deleted && !restoreDeleted {
+		return fmt.Errorf("%s rowid %d is deleted as of %s; pass restoreDeleted to restore it", table, rowid, at)
+	}
+
+	return sh.applyRevert(ctx, table, rowid, state)
+}
+
+// applyRevert writes state back to table as rowid, UPDATE-ing the row if it
+// currently exists or INSERT-ing it (with its original rowid) if it doesn't.
+func (sh *SQLiteHistory) applyRevert(ctx context.Context, table string, rowid int64, state map[string]any) error {
+	names, err := sh.columnNamesFor(ctx, sh.db, table)
+	if err != nil {
+		return err
+	}
+
+	tx, err := sh.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT 1 FROM %s WHERE rowid = ?;", escapeSQLite(table)), rowid).Scan(&exists)
+	switch {
+	case err == nil:
+		var setParts []string
+		var args []any
+		for _, name := range names {
+			if v, ok := state[name]; ok {
+				setParts = append(setParts, fmt.Sprintf("%s = ?", escapeSQLite(name)))
+				args = append(args, v)
+			}
+		}
+		args = append(args, rowid)
+		updateSQL := fmt.Sprintf("UPDATE %s SET %s WHERE rowid = ?;", escapeSQLite(table), strings.Join(setParts, ", "))
+		if _, err := tx.ExecContext(ctx, updateSQL, args...); err != nil {
+			return fmt.Errorf("failed to revert row: %w", err)
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		insertCols := []string{"rowid"}
+		placeholders := []string{"?"}
+		args := []any{rowid}
+		for _, name := range names {
+			if v, ok := state[name]; ok {
+				insertCols = append(insertCols, escapeSQLite(name))
+				placeholders = append(placeholders, "?")
+				args = append(args, v)
+			}
+		}
+		insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);",
+			escapeSQLite(table), strings.Join(insertCols, ", "), strings.Join(placeholders, ", "))
+		if _, err := tx.ExecContext(ctx, insertSQL, args...); err != nil {
+			return fmt.Errorf("failed to restore row: %w", err)
+		}
+	default:
+		return fmt.Errorf("failed to check if row exists: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// RetentionPolicy controls how Prune trims a table's history.
+type RetentionPolicy struct {
+	// MaxAge deletes non-checkpoint history entries older than this relative
+	// to when Prune runs. Zero disables age-based pruning.
+	MaxAge time.Duration
+	// MaxVersionsPerRow keeps at most this many of the most recent entries
+	// per rowid, applied after age-based pruning. Zero disables it.
+	MaxVersionsPerRow int
+	// KeepCheckpointEvery materializes an additional checkpoint at this
+	// interval back from the MaxAge boundary, so time-travel queries further
+	// in the past than the boundary keep resolving instead of only the
+	// single most recent surviving state. Zero checkpoints only the MaxAge
+	// boundary itself.
+	KeepCheckpointEvery time.Duration
+}
+
+// SetRetention stores the retention policy for table in _sqlite_history_meta
+// so Prune and PruneAll can find it across restarts. Calling it again
+// replaces the previously stored policy.
+func (sh *SQLiteHistory) SetRetention(ctx context.Context, table string, policy RetentionPolicy) error {
+	tx, err := sh.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := sh.ensureMetaTable(ctx, tx); err != nil {
+		return fmt.Errorf("failed to create meta table: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+INSERT INTO _sqlite_history_meta (table_name, schema_version, columns, max_age_ms, max_versions_per_row, keep_checkpoint_every_ms)
+VALUES (?, 0, '', ?, ?, ?)
+ON CONFLICT(table_name) DO UPDATE SET
+    max_age_ms = excluded.max_age_ms,
+    max_versions_per_row = excluded.max_versions_per_row,
+    keep_checkpoint_every_ms = excluded.keep_checkpoint_every_ms;
+`, table, policy.MaxAge.Milliseconds(), policy.MaxVersionsPerRow, policy.KeepCheckpointEvery.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to store retention policy: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// readRetention returns the retention policy previously stored for table, or
+// ok = false if SetRetention has never been called for it.
+func (sh *SQLiteHistory) readRetention(ctx context.Context, tx *sql.Tx, table string) (policy RetentionPolicy, ok bool, err error) {
+	var maxAgeMs, checkpointMs int64
+	var maxVersions int
+	err = tx.QueryRowContext(ctx, 
+		`SELECT max_age_ms, max_versions_per_row, keep_checkpoint_every_ms FROM _sqlite_history_meta WHERE table_name = ?;`,
+		table,
+	).Scan(&maxAgeMs, &maxVersions, &checkpointMs)
+	if err == sql.ErrNoRows {
+		return RetentionPolicy{}, false, nil
+	} else if err != nil {
+		return RetentionPolicy{}, false, err
+	}
+	return RetentionPolicy{
+		MaxAge:              time.Duration(maxAgeMs) * time.Millisecond,
+		MaxVersionsPerRow:   maxVersions,
+		KeepCheckpointEvery: time.Duration(checkpointMs) * time.Millisecond,
+	}, true, nil
+}
+
+// distinctRowids returns every rowid with at least one entry in
+// _<table>_history.
+func (sh *SQLiteHistory) distinctRowids(ctx context.Context, tx *sql.Tx, table string) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT DISTINCT _rowid FROM _%s_history ORDER BY _rowid;", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rowids []int64
+	for rows.Next() {
+		var rowid int64
+		if err := rows.Scan(&rowid); err != nil {
+			return nil, err
+		}
+		rowids = append(rowids, rowid)
+	}
+	return rowids, rows.Err()
+}
+
+// checkpointRow rewrites rowid's history entry at or immediately before
+// cutoff (interpreted per cutoffColumn, as for reconstructRowBy) to hold
+// every column's full coalesced value with _mask set to fullActiveMask(bits),
+// so it stands alone as a snapshot of the row's state at that point. It
+// reports the version of that entry so Prune can exempt it - and, for a
+// deleted row, the tombstone entry itself - from the delete it runs
+// afterward; ok is false if the row has no entry at or before cutoff, which
+// means there's nothing for Prune to preserve there either.
+//
+// If the row was already deleted by cutoff, checkpointRow leaves the
+// tombstone entry untouched (there's no live state to rewrite it to) but
+// still reports its version, so the caller keeps it rather than deleting it
+// as just another aged-out delta - without it, a later time-travel query
+// would see only the row's original insert and wrongly report it as live.
+func (sh *SQLiteHistory) checkpointRow(ctx context.Context, tx *sql.Tx, table string, names []string, bits []int, rowid int64, cutoffColumn string, cutoff any) (version int64, ok bool, err error) {
+	state, deleted, found, err := sh.reconstructRowBy(ctx, tx, table, rowid, cutoffColumn, cutoff)
+	if err != nil {
+		return 0, false, err
+	}
+	if !found {
+		return 0, false, nil
+	}
+
+	err = tx.QueryRowContext(ctx,
+		fmt.Sprintf("SELECT MAX(_version) FROM _%s_history WHERE _rowid = ? AND %s <= ?;", table, cutoffColumn),
+		rowid, cutoff,
+	).Scan(&version)
+	if err != nil {
+		return 0, false, err
+	}
+	if deleted {
+		return version, true, nil
+	}
+
+	setParts := make([]string, 0, len(names)+1)
+	args := make([]any, 0, len(names)+3)
+	for _, name := range names {
+		setParts = append(setParts, fmt.Sprintf("%s = ?", escapeSQLite(name)))
+		args = append(args, state[name])
+	}
+	setParts = append(setParts, "_mask = ?")
+	args = append(args, fullActiveMask(bits), rowid, version)
+
+	updateSQL := fmt.Sprintf(
+		"UPDATE _%s_history SET %s WHERE _rowid = ? AND _version = ?;",
+		table, strings.Join(setParts, ", "),
+	)
+	_, err = tx.ExecContext(ctx, updateSQL, args...)
+	return version, true, err
+}
+
+// Prune trims table's history according to the policy set by SetRetention,
+// returning the number of history rows deleted. It requires SetRetention to
+// have been called for table first.
+//
+// All of the following runs in a single transaction. First, for each rowid,
+// the history entry at or immediately before the MaxAge boundary (and, if
+// KeepCheckpointEvery is set, at each further interval back from it) is
+// turned into a checkpoint: a row holding every active column's full
+// coalesced value with _mask set to fullActiveMask, same as a freshly
+// inserted row looks like - unless the row was already deleted by then, in
+// which case its tombstone entry is kept as-is instead, so the row still
+// reports as deleted rather than reappearing with stale live values. Then,
+// per rowid, every other entry older than the MaxAge boundary is deleted;
+// the checkpoint/tombstone entries just produced for that rowid are the only
+// ones exempted, not every entry that happens to carry a full mask. Finally,
+// if MaxVersionsPerRow is set, the oldest version being kept for each rowid
+// is checkpointed the same way before trimming the rest, so the surviving
+// versions can still reconstruct a complete row instead of a partial-mask
+// delta missing whatever columns aged out of the kept window.
+//
+// If vacuumAfter is true, Prune runs VACUUM after committing to reclaim the
+// disk space SQLite otherwise leaves in the free list.
+func (sh *SQLiteHistory) Prune(ctx context.Context, table string, vacuumAfter bool) (int64, error) {
+	tx, err := sh.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	policy, ok, err := sh.readRetention(ctx, tx, table)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read retention policy: %w", err)
+	}
+	if !ok {
+		return 0, fmt.Errorf("no retention policy set for table %s; call SetRetention first", table)
+	}
+
+	names, err := sh.columnNamesFor(ctx, tx, table)
+	if err != nil {
+		return 0, err
+	}
+	bits, err := sh.columnBits(ctx, tx, table, names)
+	if err != nil {
+		return 0, fmt.Errorf("failed to assign mask bits: %w", err)
+	}
+
+	var deleted int64
+
+	rowids, err := sh.distinctRowids(ctx, tx, table)
+	if err != nil {
+		return 0, err
+	}
+
+	if policy.MaxAge > 0 {
+		boundary := time.Now().Add(-policy.MaxAge)
+		checkpoints := []time.Time{boundary}
+		if policy.KeepCheckpointEvery > 0 {
+			for t := boundary.Add(-policy.KeepCheckpointEvery); ; t = t.Add(-policy.KeepCheckpointEvery) {
+				var exists int
+				err := tx.QueryRowContext(ctx, 
+					fmt.Sprintf("SELECT 1 FROM _%s_history WHERE _updated <= ? LIMIT 1;", table),
+					t.UnixMilli(),
+				).Scan(&exists)
+				if err == sql.ErrNoRows {
+					break
+				} else if err != nil {
+					return deleted, err
+				}
+				checkpoints = append(checkpoints, t)
+			}
+		}
+
+		for _, rowid := range rowids {
+			keepVersions := make([]int64, 0, len(checkpoints))
+			for _, cp := range checkpoints {
+				version, ok, err := sh.checkpointRow(ctx, tx, table, names, bits, rowid, "_updated", cp.UnixMilli())
+				if err != nil {
+					return deleted, fmt.Errorf("failed to checkpoint %s rowid %d: %w", table, rowid, err)
+				}
+				if ok {
+					keepVersions = append(keepVersions, version)
+				}
+			}
+
+			query := fmt.Sprintf("DELETE FROM _%s_history WHERE _rowid = ? AND _updated < ?", table)
+			args := []any{rowid, boundary.UnixMilli()}
+			if len(keepVersions) > 0 {
+				placeholders := make([]string, len(keepVersions))
+				for i, v := range keepVersions {
+					placeholders[i] = "?"
+					args = append(args, v)
+				}
+				query += fmt.Sprintf(" AND _version NOT IN (%s)", strings.Join(placeholders, ", "))
+			}
+			res, err := tx.ExecContext(ctx, query+";", args...)
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete aged-out history for %s rowid %d: %w", table, rowid, err)
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+		}
+	}
+
+	if policy.MaxVersionsPerRow > 0 {
+		for _, rowid := range rowids {
+			var keepFromVersion sql.NullInt64
+			err := tx.QueryRowContext(ctx, fmt.Sprintf(
+				"SELECT MIN(_version) FROM (SELECT _version FROM _%s_history WHERE _rowid = ? ORDER BY _version DESC LIMIT ?);",
+				table,
+			), rowid, policy.MaxVersionsPerRow).Scan(&keepFromVersion)
+			if err != nil {
+				return deleted, fmt.Errorf("failed to find oldest kept version for %s rowid %d: %w", table, rowid, err)
+			}
+			if !keepFromVersion.Valid {
+				continue
+			}
+			if _, _, err := sh.checkpointRow(ctx, tx, table, names, bits, rowid, "_version", keepFromVersion.Int64); err != nil {
+				return deleted, fmt.Errorf("failed to checkpoint %s rowid %d: %w", table, rowid, err)
+			}
+		}
+
+		res, err := tx.ExecContext(ctx, fmt.Sprintf(`
+DELETE FROM _%s_history
+WHERE (_rowid, _version) NOT IN (
+    SELECT _rowid, _version FROM (
+        SELECT _rowid, _version,
+            ROW_NUMBER() OVER (PARTITION BY _rowid ORDER BY _version DESC) AS rn
+        FROM _%s_history
+    )
+    WHERE rn <= ?
+);`, table, table), policy.MaxVersionsPerRow)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to prune to max versions per row: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return deleted, fmt.Errorf("failed to commit: %w", err)
+	}
+
+	if vacuumAfter {
+		if _, err := sh.db.ExecContext(ctx, "VACUUM;"); err != nil {
+			return deleted, fmt.Errorf("failed to vacuum: %w", err)
+		}
+	}
+
+	return deleted, nil
+}
+
+// PruneAll runs Prune for every regular table that has a retention policy
+// set, returning the total number of history rows deleted across all of
+// them. Tables without a policy are skipped rather than treated as an error.
+func (sh *SQLiteHistory) PruneAll(ctx context.Context, vacuumAfter bool) (int64, error) {
+	tables, err := sh.GetAllRegularTables(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	var total int64
+	for _, table := range tables {
+		tx, err := sh.db.BeginTx(ctx, nil)
+		if err != nil {
+			return total, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		_, ok, err := sh.readRetention(ctx, tx, table)
+		tx.Rollback()
+		if err != nil {
+			return total, fmt.Errorf("failed to read retention policy for %s: %w", table, err)
+		}
+		if !ok {
+			continue
+		}
+
+		deleted, err := sh.Prune(ctx, table, false)
+		if err != nil {
+			return total, fmt.Errorf("failed to prune %s: %w", table, err)
+		}
+		total += deleted
+	}
+
+	if vacuumAfter {
+		if _, err := sh.db.ExecContext(ctx, "VACUUM;"); err != nil {
+			return total, fmt.Errorf("failed to vacuum: %w", err)
+		}
+	}
+
+	return total, nil
+}
+
+// GetAllRegularTables returns all non-system tables
+func (sh *SQLiteHistory) GetAllRegularTables(ctx context.Context) ([]string, error) {
+	// Get FTS and system tables to exclude
+	hiddenTablesQuery := `
+		SELECT name FROM sqlite_master
+		WHERE type = 'table'
+		AND (
+			sql LIKE '%VIRTUAL TABLE%USING FTS%'
+		) OR name IN ('sqlite_sequence', 'sqlite_stat1', 'sqlite_stat2', 'sqlite_stat3', 'sqlite_stat4')
+	`
+
+	rows, err := sh.db.QueryContext(ctx, hiddenTablesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hiddenTables := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		hiddenTables[name] = true
+	}
+
+	// Get all table names
+	allTablesQuery := "SELECT name FROM sqlite_master WHERE type='table';"
+	rows, err = sh.db.QueryContext(ctx, allTablesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var regularTables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		// Skip if it's a hidden table or starts with a hidden table name
+		shouldSkip := false
+		for hiddenTable := range hiddenTables {
+			if strings.HasPrefix(name, hiddenTable) {
+				shouldSkip = true
+				break
+			}
+		}
+
+		if !shouldSkip {
+			regularTables = append(regularTables, name)
+		}
+	}
+
+	return regularTables, rows.Err()
+}
+
+// TableExists reports whether a table exists in the database.
+func (sh *SQLiteHistory) TableExists(ctx context.Context, tableName string) (bool, error) {
+	query := "SELECT name FROM sqlite_master WHERE type='table' AND name = ?;"
+	var name string
+	err := sh.db.QueryRowContext(ctx, query, tableName).Scan(&name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SQLite reserved words
+var reservedWords = map[string]bool{
+	"abort": true, "action": true, "add": true, "after": true, "all": true, "alter": true,
+	"analyze": true, "and": true, "as": true, "asc": true, "attach": true, "autoincrement": true,
+	"before": true, "begin": true, "between": true, "by": true, "cascade": true, "case": true,
+	"cast": true, "check": true, "collate": true, "column": true, "commit": true, "conflict": true,
+	"constraint": true, "create": true, "cross": true, "current_date": true, "current_time": true,
+	"current_timestamp": true, "database": true, "default": true, "deferrable": true,
+	"deferred": true, "delete": true, "desc": true, "detach": true, "distinct": true, "drop": true,
+	"each": true, "else": true, "end": true, "escape": true, "except": true, "exclusive": true,
+	"exists": true, "explain": true, "fail": true, "for": true, "foreign": true, "from": true,
+	"full": true, "glob": true, "group": true, "having": true, "if": true, "ignore": true,
+	"immediate": true, "in": true, "index": true, "indexed": true, "initially": true, "inner": true,
+	"insert": true, "instead": true, "intersect": true, "into": true, "is": true, "isnull": true,
+	"join": true, "key": true, "left": true, "like": true, "limit": true, "match": true,
+	"natural": true, "no": true, "not": true, "notnull": true, "null": true, "of": true,
+	"offset": true, "on": true, "or": true, "order": true, "outer": true, "plan": true,
+	"pragma": true, "primary": true, "query": true, "raise": true, "recursive": true,
+	"references": true, "regexp": true, "reindex": true, "release": true, "rename": true,
+	"replace": true, "restrict": true, "right": true, "rollback": true, "row": true,
+	"savepoint": true, "select": true, "set": true, "table": true, "temp": true, "temporary": true,
+	"then": true, "to": true, "transaction": true, "trigger": true, "union": true, "unique": true,
+	"update": true, "using": true, "vacuum": true, "values": true, "view": true, "virtual": true,
+	"when": true, "where": true, "with": true, "without": true,
+}
+
+var validIdentifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// escapeSQLite escapes SQLite identifiers
+func escapeSQLite(s string) string {
+	if validIdentifier.MatchString(s) && !reservedWords[strings.ToLower(s)] {
+		return s
+	}
+	return fmt.Sprintf("[%s]", s)
+}
+
@@ -0,0 +1,128 @@
+package sqlitehistory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file::memory:?cache=shared")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	// A shared in-memory database backs every connection in the pool with
+	// the same database, but only one connection may hold the write lock at
+	// a time; capping the pool at one connection avoids SQLITE_BUSY errors
+	// between a connection holding an open transaction and another one
+	// trying to read or write concurrently.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// ageHistory pushes every _updated timestamp in table's history back by age,
+// so tests can exercise MaxAge-based pruning without waiting in real time.
+func ageHistory(t *testing.T, db *sql.DB, table string, age time.Duration) {
+	t.Helper()
+	_, err := db.Exec("UPDATE _"+table+"_history SET _updated = _updated - ?;", age.Milliseconds())
+	if err != nil {
+		t.Fatalf("failed to age history: %v", err)
+	}
+}
+
+func TestPruneDeletedRowDoesNotResurrect(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	if _, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, val TEXT);"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	sh := New(db)
+	if err := sh.ConfigureHistory(ctx, "items", ConfigureOptions{}); err != nil {
+		t.Fatalf("ConfigureHistory: %v", err)
+	}
+
+	if _, err := db.Exec("INSERT INTO items (id, val) VALUES (1, 'a');"); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if _, err := db.Exec("UPDATE items SET val = 'b' WHERE id = 1;"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := db.Exec("DELETE FROM items WHERE id = 1;"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// Push every entry's _updated timestamp well past the retention
+	// boundary the policy below sets, so the whole insert/update/delete
+	// sequence is eligible for pruning.
+	ageHistory(t, db, "items", 48*time.Hour)
+
+	if err := sh.SetRetention(ctx, "items", RetentionPolicy{MaxAge: 24 * time.Hour}); err != nil {
+		t.Fatalf("SetRetention: %v", err)
+	}
+	if _, err := sh.Prune(ctx, "items", false); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+
+	if _, err := sh.RowAt(ctx, "items", 1, time.Now()); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("RowAt after pruning a deleted row = %v, want sql.ErrNoRows", err)
+	}
+
+	rows, err := sh.TableAt(ctx, "items", time.Now())
+	if err != nil {
+		t.Fatalf("TableAt: %v", err)
+	}
+	defer rows.Close()
+	if rows.Next() {
+		t.Fatal("TableAt reports a row that was deleted before the retention boundary as live")
+	}
+}
+
+func TestPruneMaxVersionsPerRowReconstructs(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	if _, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, val TEXT);"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	sh := New(db)
+	if err := sh.ConfigureHistory(ctx, "items", ConfigureOptions{}); err != nil {
+		t.Fatalf("ConfigureHistory: %v", err)
+	}
+
+	if _, err := db.Exec("INSERT INTO items (id, val) VALUES (1, 'v0');"); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		if _, err := db.Exec("UPDATE items SET val = ? WHERE id = 1;", "v"+string(rune('0'+i))); err != nil {
+			t.Fatalf("update %d: %v", i, err)
+		}
+	}
+
+	if err := sh.SetRetention(ctx, "items", RetentionPolicy{MaxVersionsPerRow: 2}); err != nil {
+		t.Fatalf("SetRetention: %v", err)
+	}
+	if _, err := sh.Prune(ctx, "items", false); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+
+	state, err := sh.RowAt(ctx, "items", 1, time.Now())
+	if err != nil {
+		t.Fatalf("RowAt: %v", err)
+	}
+	if state["val"] != "v5" {
+		t.Fatalf("RowAt val = %v, want v5", state["val"])
+	}
+	if _, ok := state["id"]; !ok {
+		t.Fatalf("RowAt lost the id column after pruning to MaxVersionsPerRow: %v", state)
+	}
+	if id, ok := state["id"].(int64); !ok || id != 1 {
+		t.Fatalf("RowAt id = %v, want 1", state["id"])
+	}
+}